@@ -54,6 +54,11 @@ For example: "\w" will be wrongly converted to "\[AT]".
 		chunkSize := getFlagInt(cmd, "chunk-size")
 		threads := getFlagInt(cmd, "threads")
 		outFile := getFlagString(cmd, "out-file")
+		outFormat := getFlagString(cmd, "out-format")
+		gff3FeatureType = getFlagString(cmd, "gff3-feature-type")
+
+		writer, err := newLocationWriter(outFormat)
+		checkError(err)
 
 		if chunkSize <= 0 || threads <= 0 {
 			checkError(fmt.Errorf("value of flag -c, -j, -w should be greater than 0"))
@@ -66,8 +71,10 @@ For example: "\w" will be wrongly converted to "\[AT]".
 		ignoreCase := getFlagBool(cmd, "ignore-case")
 		onlyPositiveStrand := getFlagBool(cmd, "only-positive-strand")
 
-		if len(pattern) == 0 && patternFile == "" {
-			checkError(fmt.Errorf("one of flags --pattern and --pattern-file needed"))
+		indexFile := getFlagString(cmd, "index")
+
+		if len(pattern) == 0 && patternFile == "" && indexFile == "" {
+			checkError(fmt.Errorf("one of flags --pattern, --pattern-file or --index needed"))
 		}
 
 		files := getFileList(args)
@@ -76,54 +83,181 @@ For example: "\w" will be wrongly converted to "\[AT]".
 		regexps := make(map[string]*regexp.Regexp)
 		patterns := make(map[string][]byte)
 		var s string
-		if patternFile != "" {
-			records, err := fasta.GetSeqsMap(patternFile, nil, 1000, runtime.NumCPU(), "")
+		if indexFile == "" {
+			if patternFile != "" {
+				records, err := fasta.GetSeqsMap(patternFile, nil, 1000, runtime.NumCPU(), "")
+				checkError(err)
+				for name, record := range records {
+					patterns[name] = record.Seq.Seq
+
+					if degenerate {
+						s = record.Seq.Degenerate2Regexp()
+					} else {
+						s = string(record.Seq.Seq)
+					}
+
+					if ignoreCase {
+						s = "(?i)" + s
+					}
+					re, err := regexp.Compile(s)
+					checkError(err)
+					regexps[name] = re
+				}
+			} else {
+				for _, p := range pattern {
+					patterns[p] = []byte(p)
+
+					if degenerate {
+						pattern2seq, err := seq.NewSeq(alphabet, []byte(p))
+						if err != nil {
+							checkError(fmt.Errorf("it seems that flag -d is given, "+
+								"but you provide regular expression instead of available %s sequence", alphabet))
+						}
+						s = pattern2seq.Degenerate2Regexp()
+					} else {
+						s = p
+					}
+
+					if ignoreCase {
+						s = "(?i)" + s
+					}
+					re, err := regexp.Compile(s)
+					checkError(err)
+					regexps[p] = re
+				}
+			}
+		}
+
+		var seedIndex *SeedIndex
+		var seedIndexRegexps []*regexp.Regexp
+		useIndex := indexFile != ""
+		if useIndex {
+			idx, err := LoadSeedIndex(indexFile)
+			checkError(err)
+			res, err := idx.compileRegexps()
 			checkError(err)
-			for name, record := range records {
-				patterns[name] = record.Seq.Seq
+			seedIndex = idx
+			seedIndexRegexps = res
+			for _, p := range idx.Patterns {
+				patterns[p.Name] = p.Pattern
+			}
+		}
 
-				if degenerate {
-					s = record.Seq.Degenerate2Regexp()
+		mismatches := getFlagInt(cmd, "mismatches")
+		editDistance := getFlagInt(cmd, "edit-distance")
+		if mismatches >= 0 && editDistance >= 0 {
+			checkError(fmt.Errorf("flags --mismatches and --edit-distance are mutually exclusive"))
+		}
+		if useIndex && (mismatches >= 0 || editDistance >= 0) {
+			checkError(fmt.Errorf("flag --index cannot be combined with --mismatches/--edit-distance"))
+		}
+		useApprox := !useIndex && (mismatches >= 0 || editDistance >= 0)
+
+		var fwdApprox, revApprox map[string]approxMatcher
+		if useApprox {
+			extraIntColumnName = "mismatches"
+			fwdApprox = make(map[string]approxMatcher)
+			revApprox = make(map[string]approxMatcher)
+			for name, pat := range patterns {
+				rc := reverseComplementIUPAC(pat)
+				if mismatches >= 0 {
+					fwd, err := newShiftOrMatcher(pat, mismatches)
+					checkError(err)
+					rev, err := newShiftOrMatcher(rc, mismatches)
+					checkError(err)
+					fwdApprox[name] = fwd
+					revApprox[name] = rev
 				} else {
-					s = string(record.Seq.Seq)
+					fwdApprox[name] = &editMatcher{pat, editDistance}
+					revApprox[name] = &editMatcher{rc, editDistance}
 				}
+			}
+		}
 
-				if ignoreCase {
-					s = "(?i)" + s
+		engine := getFlagString(cmd, "engine")
+		maxExpansion := getFlagInt(cmd, "max-expansion")
+
+		// isACEligible reports whether pat can be fed to the Aho-Corasick
+		// engine: as a literal when --degenerate isn't set, or, when it
+		// is, after expanding its IUPAC codes to concrete sequences --
+		// provided that expansion doesn't blow past --max-expansion.
+		isACEligible := func(pat []byte) bool {
+			if degenerate {
+				return isACDegenerateLiteral(pat) && expandDegenerateWindow(pat, maxExpansion) != nil
+			}
+			return isACLiteral(pat)
+		}
+
+		var useAC bool
+		if !useIndex && !useApprox {
+			allEligible := true
+			for _, pat := range patterns {
+				if !isACEligible(pat) {
+					allEligible = false
+					break
 				}
-				re, err := regexp.Compile(s)
-				checkError(err)
-				regexps[name] = re
 			}
-		} else {
-			for _, p := range pattern {
-				patterns[p] = []byte(p)
 
-				if degenerate {
-					pattern2seq, err := seq.NewSeq(alphabet, []byte(p))
-					if err != nil {
-						checkError(fmt.Errorf("it seems that flag -d is given, "+
-							"but you provide regular expression instead of available %s sequence", alphabet))
+			switch engine {
+			case "", "auto":
+				useAC = allEligible
+			case "ac":
+				if !allEligible {
+					if degenerate {
+						checkError(fmt.Errorf("--engine ac requires all patterns to be literal IUPAC nucleotide codes expanding to at most --max-expansion (%d) concrete sequences", maxExpansion))
+					} else {
+						checkError(fmt.Errorf("--engine ac requires all patterns to be literal ACGTN/ACGUN sequences"))
 					}
-					s = pattern2seq.Degenerate2Regexp()
-				} else {
-					s = p
 				}
+				useAC = true
+			case "regexp":
+				useAC = false
+			default:
+				checkError(fmt.Errorf("invalid value for flag --engine: %s. available values: auto, regexp, ac", engine))
+			}
+		}
 
-				if ignoreCase {
-					s = "(?i)" + s
+		var fwdScanner, revScanner *ACScanner
+		if useAC {
+			fwdScanner = NewACScanner(ignoreCase)
+			revScanner = NewACScanner(ignoreCase)
+			for name, pat := range patterns {
+				if degenerate {
+					rc := reverseComplementIUPAC(pat)
+					for _, lit := range expandDegenerateWindow(pat, maxExpansion) {
+						fwdScanner.Add(name, []byte(lit))
+					}
+					for _, lit := range expandDegenerateWindow(rc, maxExpansion) {
+						revScanner.Add(name, []byte(lit))
+					}
+				} else {
+					fwdScanner.Add(name, pat)
+					revScanner.Add(name, reverseComplementLiteral(pat))
 				}
-				re, err := regexp.Compile(s)
-				checkError(err)
-				regexps[p] = re
 			}
+			fwdScanner.Build()
+			revScanner.Build()
+		}
+
+		mergeHits = getFlagBool(cmd, "merge")
+		nonOverlappingHits = getFlagBool(cmd, "non-overlapping")
+		if mergeHits {
+			extraIntColumnName = "hits"
+		}
+
+		maskRegionsInvert = getFlagBool(cmd, "invert")
+		maskRegionsFile := getFlagString(cmd, "mask-regions")
+		if maskRegionsFile != "" {
+			regions, err := loadMaskRegions(maskRegionsFile)
+			checkError(err)
+			maskRegionsBySeq = regions
 		}
 
 		outfh, err := xopen.Wopen(outFile)
 		checkError(err)
 		defer outfh.Close()
 
-		outfh.WriteString("seqID\tpatternName\tpattern\tstrand\tstart\tend\tmatched\n")
+		checkError(writer.WriteHeader(outfh))
 		for _, file := range files {
 
 			ch := make(chan LocationChunk, threads)
@@ -135,46 +269,12 @@ For example: "\w" will be wrongly converted to "\[AT]".
 				chunks := make(map[uint64]LocationChunk)
 				for chunk := range ch {
 					if chunk.ID == id {
-						for _, locationInfo := range chunk.Data {
-							var s []byte
-							for _, loc := range locationInfo.Locations {
-								if locationInfo.Strand == 1 {
-									s = locationInfo.Record.Seq.Seq[loc[0]:loc[1]]
-								} else {
-									s = locationInfo.Record.Seq.SubSeq(loc[0]+1, loc[1]).RevCom().Seq
-								}
-								outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
-									locationInfo.Record.ID,
-									locationInfo.PatternName,
-									patterns[locationInfo.PatternName],
-									locationInfo.Strand,
-									loc[0]+1,
-									loc[1],
-									s))
-							}
-						}
+						writeLocationChunk(outfh, writer, patterns, chunk)
 						id++
 					} else { // check bufferd result
 						for true {
 							if chunk, ok := chunks[id]; ok {
-								for _, locationInfo := range chunk.Data {
-									var s []byte
-									for _, loc := range locationInfo.Locations {
-										if locationInfo.Strand == 1 {
-											s = locationInfo.Record.Seq.Seq[loc[0]:loc[1]]
-										} else {
-											s = locationInfo.Record.Seq.SubSeq(loc[0]+1, loc[1]).RevCom().Seq
-										}
-										outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
-											locationInfo.Record.ID,
-											locationInfo.PatternName,
-											patterns[locationInfo.PatternName],
-											locationInfo.Strand,
-											loc[0]+1,
-											loc[1],
-											s))
-									}
-								}
+								writeLocationChunk(outfh, writer, patterns, chunk)
 								id++
 								delete(chunks, chunk.ID)
 							} else {
@@ -188,25 +288,7 @@ For example: "\w" will be wrongly converted to "\[AT]".
 				if len(chunks) > 0 {
 					sortedIDs := sortLocationChunkMapID(chunks)
 					for _, id := range sortedIDs {
-						chunk := chunks[id]
-						for _, locationInfo := range chunk.Data {
-							var s []byte
-							for _, loc := range locationInfo.Locations {
-								if locationInfo.Strand == 1 {
-									s = locationInfo.Record.Seq.Seq[loc[0]:loc[1]]
-								} else {
-									s = locationInfo.Record.Seq.SubSeq(loc[0]+1, loc[1]).RevCom().Seq
-								}
-								outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
-									locationInfo.Record.ID,
-									locationInfo.PatternName,
-									patterns[locationInfo.PatternName],
-									locationInfo.Strand,
-									loc[0]+1,
-									loc[1],
-									s))
-							}
-						}
+						writeLocationChunk(outfh, writer, patterns, chunks[id])
 					}
 				}
 
@@ -231,25 +313,61 @@ For example: "\w" will be wrongly converted to "\[AT]".
 					}()
 
 					var locations []LocationInfo
-					for _, record := range chunk.Data {
-						for pName, re := range regexps {
-							found := re.FindAllSubmatchIndex(record.Seq.Seq, -1)
-							if len(found) > 0 {
-								locations = append(locations, LocationInfo{record, pName, 1, found})
+					if useIndex {
+						for _, record := range chunk.Data {
+							locations = append(locations, scanSeedIndexRecord(record, seedIndex, seedIndexRegexps, onlyPositiveStrand)...)
+						}
+					} else if useApprox {
+						for _, record := range chunk.Data {
+							for name, m := range fwdApprox {
+								var locs [][]int
+								m.Scan(record.Seq.Seq, func(start, end, errors int) {
+									locs = append(locs, []int{start, end, errors})
+								})
+								if len(locs) > 0 {
+									locations = append(locations, LocationInfo{record, name, 1, locs})
+								}
 							}
 
 							if onlyPositiveStrand {
 								continue
 							}
-							seqRP := record.Seq.RevCom()
-							found = re.FindAllSubmatchIndex(seqRP.Seq, -1)
-							if len(found) > 0 {
-								l := len(seqRP.Seq)
-								tlocs := make([][]int, len(found))
-								for i, loc := range found {
-									tlocs[i] = []int{l - loc[1], l - loc[0]}
+
+							for name, m := range revApprox {
+								var locs [][]int
+								m.Scan(record.Seq.Seq, func(start, end, errors int) {
+									locs = append(locs, []int{start, end, errors})
+								})
+								if len(locs) > 0 {
+									locations = append(locations, LocationInfo{record, name, -1, locs})
+								}
+							}
+						}
+					} else if useAC {
+						for _, record := range chunk.Data {
+							locations = append(locations, scanACRecord(record, fwdScanner, revScanner, onlyPositiveStrand)...)
+						}
+					} else {
+						for _, record := range chunk.Data {
+							for pName, re := range regexps {
+								found := re.FindAllSubmatchIndex(record.Seq.Seq, -1)
+								if len(found) > 0 {
+									locations = append(locations, LocationInfo{record, pName, 1, found})
+								}
+
+								if onlyPositiveStrand {
+									continue
+								}
+								seqRP := record.Seq.RevCom()
+								found = re.FindAllSubmatchIndex(seqRP.Seq, -1)
+								if len(found) > 0 {
+									l := len(seqRP.Seq)
+									tlocs := make([][]int, len(found))
+									for i, loc := range found {
+										tlocs[i] = []int{l - loc[1], l - loc[0]}
+									}
+									locations = append(locations, LocationInfo{record, pName, -1, tlocs})
 								}
-								locations = append(locations, LocationInfo{record, pName, -1, tlocs})
 							}
 						}
 					}
@@ -277,6 +395,40 @@ type LocationInfo struct {
 	Locations   [][]int
 }
 
+// gff3FeatureType holds the value of --gff3-feature-type for the lifetime
+// of a locate run; it's read by gff3LocationWriter.
+var gff3FeatureType string
+
+// extraIntColumnName names the extra per-hit integer column tsvLocationWriter
+// should emit -- "mismatches" for --mismatches/--edit-distance, "hits" for
+// --merge, or "" when neither applies.
+var extraIntColumnName string
+
+// writeLocationChunk writes every hit in chunk.Data to outfh using writer,
+// resolving the matched subsequence for both strands.
+func writeLocationChunk(outfh *xopen.Writer, writer locationWriter, patterns map[string][]byte, chunk LocationChunk) {
+	locsByBucket := make([][][]int, len(chunk.Data))
+	for i, locationInfo := range chunk.Data {
+		locsByBucket[i] = postProcessLocations(locationInfo.Record.ID, locationInfo.Locations)
+	}
+
+	if nonOverlappingHits {
+		locsByBucket = selectNonOverlappingAcrossPatterns(chunk.Data, locsByBucket)
+	}
+
+	for i, locationInfo := range chunk.Data {
+		for _, loc := range locsByBucket[i] {
+			var matched []byte
+			if locationInfo.Strand == 1 {
+				matched = locationInfo.Record.Seq.Seq[loc[0]:loc[1]]
+			} else {
+				matched = locationInfo.Record.Seq.SubSeq(loc[0]+1, loc[1]).RevCom().Seq
+			}
+			checkError(writer.WriteHit(outfh, patterns, locationInfo, loc, matched))
+		}
+	}
+}
+
 func sortLocationChunkMapID(chunks map[uint64]LocationChunk) sortutil.Uint64Slice {
 	ids := make(sortutil.Uint64Slice, len(chunks))
 	i := 0
@@ -296,4 +448,15 @@ func init() {
 	locateCmd.Flags().BoolP("degenerate", "d", false, "pattern/motif contains degenerate base")
 	locateCmd.Flags().BoolP("ignore-case", "i", false, "ignore case")
 	locateCmd.Flags().BoolP("only-positive-strand", "P", false, "only search at positive strand")
+	locateCmd.Flags().StringP("out-format", "O", "tsv", "out format (tsv, bed, gff3)")
+	locateCmd.Flags().StringP("gff3-feature-type", "", gff3DefaultFeatureType, "GFF3 feature type (column 3), used with --out-format gff3")
+	locateCmd.Flags().StringP("engine", "", "auto", "scanning engine: auto (use Aho-Corasick when all patterns are literal), regexp, ac")
+	locateCmd.Flags().IntP("max-expansion", "", maxSeedExpansion, "with --degenerate and the Aho-Corasick engine, max concrete sequences a pattern's IUPAC codes may expand to before falling back to the regexp engine (or erroring, with --engine ac)")
+	locateCmd.Flags().IntP("mismatches", "", -1, "max number of mismatches allowed (Hamming distance, bit-parallel search); -1 disables; pattern IUPAC codes are always treated as degenerate, regardless of -d/--degenerate")
+	locateCmd.Flags().IntP("edit-distance", "", -1, "max edit distance allowed (Levenshtein, allows indels, banded DP search); -1 disables; pattern IUPAC codes are always treated as degenerate, regardless of -d/--degenerate")
+	locateCmd.Flags().BoolP("merge", "", false, "merge overlapping/adjacent hits of the same pattern on the same seqID/strand into one interval, reporting the union range and hit count")
+	locateCmd.Flags().BoolP("non-overlapping", "", false, "greedily select a maximal set of non-overlapping hits per seqID/strand, ordered by start")
+	locateCmd.Flags().StringP("mask-regions", "", "", "BED/GFF3 file of regions; hits overlapping a region are dropped (kept instead with --invert)")
+	locateCmd.Flags().BoolP("invert", "", false, "invert --mask-regions: keep only hits overlapping the mask, instead of dropping them")
+	locateCmd.Flags().StringP("index", "", "", "query a persistent motif index built with `seqkit locate-index build`, instead of --pattern/--pattern-file")
 }
@@ -0,0 +1,255 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"regexp"
+
+	"github.com/shenwei356/bio/seqio/fasta"
+)
+
+// acLiteralPattern matches an exact nucleotide pattern with no regular
+// expression metacharacters, i.e. one that can be fed straight into
+// ACScanner instead of compiled to a *regexp.Regexp.
+var acLiteralPattern = regexp.MustCompile(`^[ACGTUNacgtun]+$`)
+
+// isACLiteral reports whether pat is a plain ACGTN/ACGUN motif with no
+// regex metacharacters, making it eligible for the Aho–Corasick engine
+// when --degenerate isn't set (so "N" is searched as a literal base, same
+// as the regexp engine without -d).
+func isACLiteral(pat []byte) bool {
+	return len(pat) > 0 && acLiteralPattern.Match(pat)
+}
+
+// acIUPACPattern matches a nucleotide pattern built entirely from IUPAC
+// ambiguity codes (and no regex metacharacters), i.e. one that, with
+// --degenerate set, can be fed to the Aho–Corasick engine after expanding
+// every degenerate base to its concrete alternatives.
+var acIUPACPattern = regexp.MustCompile(`^[ACGTURYSWKMBDHVNacgturyswkmbdhvn]+$`)
+
+// isACDegenerateLiteral reports whether pat is built entirely from IUPAC
+// codes, making it eligible for the Aho–Corasick engine (via expansion)
+// when --degenerate is set.
+func isACDegenerateLiteral(pat []byte) bool {
+	return len(pat) > 0 && acIUPACPattern.Match(pat)
+}
+
+// acNode is one state of the Aho–Corasick automaton's underlying trie.
+type acNode struct {
+	children map[byte]int // byte -> node index
+	fail     int          // failure link: node index of longest proper suffix that is also a trie prefix
+	output   []int        // IDs of patterns ending at this node (including via output links, flattened at Build time)
+}
+
+// ACScanner is a multi-pattern exact-match scanner built around an
+// Aho–Corasick automaton. It reports all matches of all added patterns in
+// a single left-to-right pass over the input, which is considerably
+// faster than scanning the input once per pattern when hundreds or
+// thousands of literal motifs are searched for at once (e.g. from
+// --pattern-file).
+type ACScanner struct {
+	nodes    []*acNode
+	names    []string // patternID -> name
+	patLens  []int    // patternID -> pattern length
+	built    bool
+	foldCase bool // upper-case trie edges and scanned bytes, for --ignore-case
+}
+
+// NewACScanner returns an empty ACScanner ready to have patterns Add-ed.
+// When foldCase is true, both Add and Scan upper-case every byte first, so
+// the automaton matches case-insensitively like the regexp engine's
+// "(?i)" does.
+func NewACScanner(foldCase bool) *ACScanner {
+	return &ACScanner{nodes: []*acNode{{children: make(map[byte]int)}}, foldCase: foldCase}
+}
+
+// toUpperByte upper-cases a single ASCII byte, leaving anything else as-is.
+func toUpperByte(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+// Add inserts pat into the automaton under name, returning its pattern ID.
+// Add must be called before Build.
+func (s *ACScanner) Add(name string, pat []byte) int {
+	cur := 0
+	for _, c := range pat {
+		if s.foldCase {
+			c = toUpperByte(c)
+		}
+		next, ok := s.nodes[cur].children[c]
+		if !ok {
+			s.nodes = append(s.nodes, &acNode{children: make(map[byte]int)})
+			next = len(s.nodes) - 1
+			s.nodes[cur].children[c] = next
+		}
+		cur = next
+	}
+
+	id := len(s.patLens)
+	s.names = append(s.names, name)
+	s.patLens = append(s.patLens, len(pat))
+	s.nodes[cur].output = append(s.nodes[cur].output, id)
+	return id
+}
+
+// Build computes the failure links (by BFS over the trie) and, for each
+// node, merges in the output of its failure link so that Scan only has to
+// walk a node's own output slice. Build must be called once, after all
+// patterns have been Add-ed and before Scan.
+func (s *ACScanner) Build() {
+	var queue []int
+	root := s.nodes[0]
+	for c, child := range root.children {
+		s.nodes[child].fail = 0
+		queue = append(queue, child)
+		_ = c
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for c, child := range s.nodes[cur].children {
+			queue = append(queue, child)
+
+			fail := s.nodes[cur].fail
+			for {
+				if next, ok := s.nodes[fail].children[c]; ok && next != child {
+					s.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					s.nodes[child].fail = 0
+					break
+				}
+				fail = s.nodes[fail].fail
+			}
+
+			s.nodes[child].output = append(s.nodes[child].output, s.nodes[s.nodes[child].fail].output...)
+		}
+	}
+
+	s.built = true
+}
+
+// goto_ follows the trie edge for c from node, falling back through
+// failure links until a match (or the root) is found.
+func (s *ACScanner) goto_(node int, c byte) int {
+	for {
+		if next, ok := s.nodes[node].children[c]; ok {
+			return next
+		}
+		if node == 0 {
+			return 0
+		}
+		node = s.nodes[node].fail
+	}
+}
+
+// Scan streams seq through the automaton once, invoking cb(patternID,
+// start, end) for every match found, with start/end being 0-based,
+// end-exclusive offsets into seq (matching Go slicing conventions). Build
+// must have been called first.
+func (s *ACScanner) Scan(seq []byte, cb func(id int, start, end int)) {
+	if !s.built {
+		s.Build()
+	}
+
+	node := 0
+	for i, c := range seq {
+		if s.foldCase {
+			c = toUpperByte(c)
+		}
+		node = s.goto_(node, c)
+		for _, id := range s.nodes[node].output {
+			end := i + 1
+			start := end - s.patLens[id]
+			cb(id, start, end)
+		}
+	}
+}
+
+// Name returns the pattern name registered for patternID.
+func (s *ACScanner) Name(id int) string {
+	return s.names[id]
+}
+
+// dnaComplement maps a literal ACGTUN base (either case) to its
+// complement; any other byte complements to itself.
+var dnaComplement = map[byte]byte{
+	'A': 'T', 'T': 'A', 'C': 'G', 'G': 'C', 'U': 'A', 'N': 'N',
+	'a': 't', 't': 'a', 'c': 'g', 'g': 'c', 'u': 'a', 'n': 'n',
+}
+
+// reverseComplementLiteral reverse-complements a literal (non-regexp)
+// ACGTUN pattern.
+func reverseComplementLiteral(pat []byte) []byte {
+	n := len(pat)
+	out := make([]byte, n)
+	for i, c := range pat {
+		rc, ok := dnaComplement[c]
+		if !ok {
+			rc = c
+		}
+		out[n-1-i] = rc
+	}
+	return out
+}
+
+// scanACRecord scans one FASTA record with the forward and
+// reverse-complement-pattern automata and returns one LocationInfo per
+// (pattern, strand) that produced at least one hit, mirroring the shape
+// produced by the regexp-based engine in locateCmd.
+func scanACRecord(record *fasta.FastaRecord, fwd, rev *ACScanner, onlyPositiveStrand bool) []LocationInfo {
+	var locations []LocationInfo
+
+	// hits are grouped by pattern name, not automaton ID, so the several
+	// literals a degenerate pattern expands to share one LocationInfo.
+	fwdHits := make(map[string][][]int)
+	fwd.Scan(record.Seq.Seq, func(id, start, end int) {
+		name := fwd.Name(id)
+		fwdHits[name] = append(fwdHits[name], []int{start, end})
+	})
+	for name, locs := range fwdHits {
+		locations = append(locations, LocationInfo{record, name, 1, locs})
+	}
+
+	if onlyPositiveStrand {
+		return locations
+	}
+
+	// rev was built from reverse-complemented patterns, so scanning the
+	// forward sequence directly yields hits already in forward-strand
+	// coordinates -- no need to reverse-complement the record itself.
+	revHits := make(map[string][][]int)
+	rev.Scan(record.Seq.Seq, func(id, start, end int) {
+		name := rev.Name(id)
+		revHits[name] = append(revHits[name], []int{start, end})
+	})
+	for name, locs := range revHits {
+		locations = append(locations, LocationInfo{record, name, -1, locs})
+	}
+
+	return locations
+}
@@ -0,0 +1,280 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import "fmt"
+
+// approxMatcher finds approximate occurrences of one pattern in seq,
+// invoking cb(start, end, errors) for occurrences within the configured
+// error budget. start/end are 0-based, end-exclusive offsets into seq.
+// shiftOrMatcher reports every qualifying ending position; editMatcher
+// reports only the best ending position of each run of consecutive
+// qualifying ones.
+type approxMatcher interface {
+	Scan(seq []byte, cb func(start, end, errors int))
+}
+
+// iupacCodes maps an (uppercase) IUPAC ambiguity code to the concrete
+// bases it represents.
+var iupacCodes = map[byte]string{
+	'A': "A", 'C': "C", 'G': "G", 'T': "T", 'U': "T",
+	'R': "AG", 'Y': "CT", 'S': "GC", 'W': "AT", 'K': "GT", 'M': "AC",
+	'B': "CGT", 'D': "AGT", 'H': "ACT", 'V': "ACG", 'N': "ACGT",
+}
+
+// iupacComplement maps an (uppercase) IUPAC ambiguity code to its
+// complementary code.
+var iupacComplement = map[byte]byte{
+	'A': 'T', 'T': 'A', 'U': 'A', 'C': 'G', 'G': 'C',
+	'R': 'Y', 'Y': 'R', 'S': 'S', 'W': 'W', 'K': 'M', 'M': 'K',
+	'B': 'V', 'V': 'B', 'D': 'H', 'H': 'D', 'N': 'N',
+}
+
+func toUpperBase(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+// iupacExpand returns the concrete bases an (possibly degenerate) IUPAC
+// code matches.
+func iupacExpand(code byte) []byte {
+	if bases, ok := iupacCodes[toUpperBase(code)]; ok {
+		return []byte(bases)
+	}
+	return []byte{toUpperBase(code)}
+}
+
+// matchesIUPAC reports whether the concrete base c satisfies the
+// (possibly degenerate) pattern base pat. Used by editMatcher, which, like
+// shiftOrMatcher, always honors IUPAC codes regardless of --degenerate.
+func matchesIUPAC(pat, c byte) bool {
+	cc := toUpperBase(c)
+	for _, b := range iupacExpand(pat) {
+		if b == cc {
+			return true
+		}
+	}
+	return false
+}
+
+// reverseComplementIUPAC reverse-complements a pattern that may contain
+// degenerate IUPAC codes, preserving case.
+func reverseComplementIUPAC(pat []byte) []byte {
+	n := len(pat)
+	out := make([]byte, n)
+	for i, c := range pat {
+		lower := c >= 'a' && c <= 'z'
+		rc, ok := iupacComplement[toUpperBase(c)]
+		if !ok {
+			rc = toUpperBase(c)
+		}
+		if lower {
+			rc += 'a' - 'A'
+		}
+		out[n-1-i] = rc
+	}
+	return out
+}
+
+// shiftOrMatcher is a bit-parallel Shift-Or/Shift-And scanner that finds
+// all occurrences of pattern allowing up to k mismatches (Hamming
+// distance, i.e. same-length alignments only -- no indels). It follows
+// the classic Baeza-Yates-Gonnet / Wu-Manber k-mismatch bitap recurrence:
+// for each allowed-mismatch level d, a state word R[d] tracks, per bit j,
+// whether a length-(j+1) prefix of pattern aligns ending at the current
+// text position with at most d mismatches (0 bit = yes). Pattern length
+// is limited to 64 (one machine word).
+type shiftOrMatcher struct {
+	m    int
+	k    int
+	bit  uint64
+	mask map[byte]uint64
+}
+
+// newShiftOrMatcher builds a shiftOrMatcher for pattern, allowing up to k
+// mismatches. Degenerate IUPAC bases in pattern widen the per-position
+// mask to match any of their concrete bases -- unconditionally, unlike
+// the regexp/AC engines, which only do so when --degenerate is set.
+func newShiftOrMatcher(pattern []byte, k int) (*shiftOrMatcher, error) {
+	m := len(pattern)
+	if m == 0 {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	if m > 64 {
+		return nil, fmt.Errorf("pattern %q is %d bases, too long for the bit-parallel mismatch engine (max 64); use --edit-distance instead", pattern, m)
+	}
+
+	sm := &shiftOrMatcher{m: m, k: k, bit: 1 << uint(m-1), mask: make(map[byte]uint64)}
+
+	for j, p := range pattern {
+		for _, b := range iupacExpand(p) {
+			sm.clearBit(b, j)
+			sm.clearBit(b+('a'-'A'), j)
+		}
+	}
+
+	return sm, nil
+}
+
+func (sm *shiftOrMatcher) clearBit(c byte, j int) {
+	v, ok := sm.mask[c]
+	if !ok {
+		v = ^uint64(0)
+	}
+	sm.mask[c] = v &^ (1 << uint(j))
+}
+
+func (sm *shiftOrMatcher) maskFor(c byte) uint64 {
+	if v, ok := sm.mask[c]; ok {
+		return v
+	}
+	return ^uint64(0) // an unknown symbol matches nothing
+}
+
+// Scan implements approxMatcher.
+func (sm *shiftOrMatcher) Scan(seq []byte, cb func(start, end, errors int)) {
+	R := make([]uint64, sm.k+1)
+	for d := range R {
+		R[d] = ^uint64(0)
+	}
+
+	for i, c := range seq {
+		maskC := sm.maskFor(c)
+
+		prev := R[0]
+		R[0] = (R[0] << 1) | maskC
+		for d := 1; d <= sm.k; d++ {
+			next := R[d]
+			R[d] = ((R[d] << 1) | maskC) & (prev << 1)
+			prev = next
+		}
+
+		for d := 0; d <= sm.k; d++ {
+			if R[d]&sm.bit == 0 {
+				end := i + 1
+				cb(end-sm.m, end, d)
+				break
+			}
+		}
+	}
+}
+
+// editMatcher finds approximate occurrences of pattern allowing up to
+// maxEdits single-character insertions, deletions or substitutions
+// (Levenshtein distance), via a banded dynamic-programming scan.
+type editMatcher struct {
+	pattern  []byte
+	maxEdits int
+}
+
+// Scan implements approxMatcher.
+func (e *editMatcher) Scan(seq []byte, cb func(start, end, errors int)) {
+	m := len(e.pattern)
+	if m == 0 {
+		return
+	}
+
+	// D[j] is the edit distance between pattern[:j] and the best-scoring
+	// suffix of the text seen so far ending at the current position
+	// (D[0] is reset to 0 every position, i.e. a match may start
+	// anywhere). St[j] tracks the start offset of whichever alignment
+	// achieved D[j], following the same diagonal/up/left moves, so the
+	// reported start is the real alignment start rather than a
+	// worst-case band width. lastActive bounds how far into the pattern
+	// it is still possible to be within maxEdits, so the band only grows
+	// one column per text character.
+	D := make([]int, m+1)
+	St := make([]int, m+1)
+	for j := range D {
+		D[j] = j
+	}
+	lastActive := m
+
+	// A run of consecutive text positions all scoring within maxEdits
+	// corresponds to one underlying occurrence; only its best position is
+	// reported once the run ends, preferring fewest errors and, among
+	// ties, the span closest to len(pattern) (i.e. the explanation using
+	// the fewest indels).
+	var pending bool
+	var bestErrors, bestStart, bestEnd int
+	flush := func() {
+		if pending {
+			cb(bestStart, bestEnd, bestErrors)
+			pending = false
+		}
+	}
+
+	for i, c := range seq {
+		diag, diagSt := D[0], St[0]
+		D[0] = 0
+		St[0] = i + 1
+
+		maxJ := lastActive
+		if maxJ < m {
+			maxJ++
+		}
+
+		newLastActive := 0
+		for j := 1; j <= maxJ; j++ {
+			old, oldSt := D[j], St[j]
+
+			cost := 1
+			if matchesIUPAC(e.pattern[j-1], c) {
+				cost = 0
+			}
+
+			v, vSt := diag+cost, diagSt // substitution/match
+			if d := old + 1; d < v {
+				v, vSt = d, oldSt // insertion (skip a text base)
+			}
+			if ins := D[j-1] + 1; ins < v {
+				v, vSt = ins, St[j-1] // deletion (skip a pattern base)
+			}
+			D[j], St[j] = v, vSt
+			diag, diagSt = old, oldSt
+
+			if v <= e.maxEdits {
+				newLastActive = j
+			}
+		}
+		lastActive = newLastActive
+
+		if D[m] <= e.maxEdits {
+			start, end, errors := St[m], i+1, D[m]
+			if !pending || errors < bestErrors || (errors == bestErrors && absInt(end-start-m) < absInt(bestEnd-bestStart-m)) {
+				bestErrors, bestStart, bestEnd = errors, start, end
+			}
+			pending = true
+		} else {
+			flush()
+		}
+	}
+	flush()
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
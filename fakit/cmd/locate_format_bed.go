@@ -0,0 +1,56 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/brentp/xopen"
+)
+
+// bedLocationWriter writes hits as 6-column BED: chrom, start (0-based),
+// end, name, score, strand. This lets locate output be piped straight into
+// bedtools/IGV without a downstream awk step.
+type bedLocationWriter struct{}
+
+func (bedLocationWriter) WriteHeader(outfh *xopen.Writer) error {
+	return nil
+}
+
+func (bedLocationWriter) WriteHit(outfh *xopen.Writer, patterns map[string][]byte, locationInfo LocationInfo, loc []int, matched []byte) error {
+	// BED's score column has no other use here, so when --mismatches/
+	// --edit-distance/--merge populate an extra int (loc[2]), report it
+	// there instead of silently dropping it; otherwise fall back to the
+	// match length.
+	score := len(matched)
+	if extraIntColumnName != "" && len(loc) >= 3 {
+		score = loc[2]
+	}
+
+	_, err := outfh.WriteString(fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\n",
+		locationInfo.Record.ID,
+		loc[0],
+		loc[1],
+		locationInfo.PatternName,
+		score,
+		strandSymbol(locationInfo.Strand)))
+	return err
+}
@@ -0,0 +1,63 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brentp/xopen"
+)
+
+// gff3DefaultFeatureType is used for the GFF3 "type" column (3) unless
+// overridden with --gff3-feature-type.
+const gff3DefaultFeatureType = "motif"
+
+// gff3LocationWriter writes hits as GFF3 features with source=seqkit,
+// phase ".", and ID/Name/Note attributes.
+type gff3LocationWriter struct{}
+
+func (gff3LocationWriter) WriteHeader(outfh *xopen.Writer) error {
+	_, err := outfh.WriteString("##gff-version 3\n")
+	return err
+}
+
+func (gff3LocationWriter) WriteHit(outfh *xopen.Writer, patterns map[string][]byte, locationInfo LocationInfo, loc []int, matched []byte) error {
+	featureType := gff3FeatureType
+	if featureType == "" {
+		featureType = gff3DefaultFeatureType
+	}
+
+	attributes := fmt.Sprintf("ID=%s_%d_%d;Name=%s;Note=%s",
+		locationInfo.Record.ID, loc[0]+1, loc[1], locationInfo.PatternName, matched)
+	if extraIntColumnName != "" && len(loc) >= 3 {
+		attributes += fmt.Sprintf(";%s%s=%d", strings.ToUpper(extraIntColumnName[:1]), extraIntColumnName[1:], loc[2])
+	}
+
+	_, err := outfh.WriteString(fmt.Sprintf("%s\tseqkit\t%s\t%d\t%d\t.\t%s\t.\t%s\n",
+		locationInfo.Record.ID,
+		featureType,
+		loc[0]+1,
+		loc[1],
+		strandSymbol(locationInfo.Strand),
+		attributes))
+	return err
+}
@@ -0,0 +1,64 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/brentp/xopen"
+)
+
+// tsvLocationWriter is the original seqkit locate output: one line per hit
+// with columns seqID/patternName/pattern/strand/start/end/matched.
+type tsvLocationWriter struct{}
+
+func (tsvLocationWriter) WriteHeader(outfh *xopen.Writer) error {
+	if extraIntColumnName != "" {
+		_, err := outfh.WriteString(fmt.Sprintf("seqID\tpatternName\tpattern\tstrand\tstart\tend\t%s\tmatched\n", extraIntColumnName))
+		return err
+	}
+	_, err := outfh.WriteString("seqID\tpatternName\tpattern\tstrand\tstart\tend\tmatched\n")
+	return err
+}
+
+func (tsvLocationWriter) WriteHit(outfh *xopen.Writer, patterns map[string][]byte, locationInfo LocationInfo, loc []int, matched []byte) error {
+	if extraIntColumnName != "" && len(loc) >= 3 {
+		_, err := outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+			locationInfo.Record.ID,
+			locationInfo.PatternName,
+			patterns[locationInfo.PatternName],
+			locationInfo.Strand,
+			loc[0]+1,
+			loc[1],
+			loc[2],
+			matched))
+		return err
+	}
+	_, err := outfh.WriteString(fmt.Sprintf("%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+		locationInfo.Record.ID,
+		locationInfo.PatternName,
+		patterns[locationInfo.PatternName],
+		locationInfo.Strand,
+		loc[0]+1,
+		loc[1],
+		matched))
+	return err
+}
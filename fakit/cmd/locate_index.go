@@ -0,0 +1,322 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+
+	"github.com/shenwei356/bio/seqio/fasta"
+)
+
+// seedIndexMagic and seedIndexVersion identify a seqkit seed index file on
+// disk, ahead of the gob-encoded payload.
+const seedIndexMagic = "SKIX"
+const seedIndexVersion uint32 = 1
+const maxSeedExpansion = 4096
+
+// seedIndexPatternMeta is the per-pattern metadata saved alongside a
+// SeedIndex: everything a query needs to re-verify a seed hit without
+// rereading the original --pattern-file.
+type seedIndexPatternMeta struct {
+	Name    string
+	Pattern []byte // literal motif bytes, for display in locate's output
+	Length  int
+	Regexp  []byte // regexp source the pattern was compiled from; recompiled on load
+}
+
+// SeedIndex is a persistent k-mer seed prefilter for a fixed motif set,
+// built once by `seqkit locate-index build` and reused by many
+// `seqkit locate --index` queries. For each pattern, every length-K
+// window (with degenerate IUPAC bases expanded to their concrete
+// alternatives) is recorded in Seeds; at query time only the text
+// positions whose k-mer hashes to a stored seed need full regexp
+// verification, which is a large win when the same motif set is
+// searched against many FASTA inputs.
+type SeedIndex struct {
+	K        int
+	Patterns []seedIndexPatternMeta
+	Seeds    map[string][]int // kmer -> IDs of patterns that contain it
+	Short    []int            // IDs of patterns that have no seed (shorter than K, or every window over maxSeedExpansion) and are always verified directly
+}
+
+// NewSeedIndex returns an empty SeedIndex seeded with k-mers of length k.
+func NewSeedIndex(k int) *SeedIndex {
+	return &SeedIndex{K: k, Seeds: make(map[string][]int)}
+}
+
+// Add registers pat (compiled from regexpSrc) under name, seeding
+// idx.Seeds with every length-K window of pat whose expansion stays within
+// maxSeedExpansion. Patterns shorter than K can't produce a length-K seed
+// at all, and patterns none of whose windows could be seeded produce
+// none either, so both are recorded in idx.Short instead and always
+// handed to the verification regexp directly.
+func (idx *SeedIndex) Add(name string, pat []byte, regexpSrc string) {
+	id := len(idx.Patterns)
+	idx.Patterns = append(idx.Patterns, seedIndexPatternMeta{
+		Name:    name,
+		Pattern: append([]byte(nil), pat...),
+		Length:  len(pat),
+		Regexp:  []byte(regexpSrc),
+	})
+
+	if len(pat) < idx.K {
+		idx.Short = append(idx.Short, id)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i+idx.K <= len(pat); i++ {
+		for _, kmer := range expandDegenerateWindow(pat[i:i+idx.K], maxSeedExpansion) {
+			if seen[kmer] {
+				continue
+			}
+			seen[kmer] = true
+			idx.Seeds[kmer] = append(idx.Seeds[kmer], id)
+		}
+	}
+	if len(seen) == 0 {
+		idx.Short = append(idx.Short, id)
+	}
+}
+
+// expandDegenerateWindow expands a (possibly IUPAC-degenerate) window to
+// its concrete literal strings. It gives up and returns nil, rather than
+// seeding a truncated/wrong-length kmer, if expansion would exceed limit
+// -- e.g. a window containing several "N"s.
+func expandDegenerateWindow(window []byte, limit int) []string {
+	results := []string{""}
+	for _, c := range window {
+		bases := iupacExpand(c)
+		if len(results)*len(bases) > limit {
+			return nil
+		}
+		next := make([]string, 0, len(results)*len(bases))
+		for _, prefix := range results {
+			for _, b := range bases {
+				next = append(next, prefix+string(b))
+			}
+		}
+		results = next
+	}
+	return results
+}
+
+// candidateWindows hashes every k-mer of seq and, for each stored seed
+// hit, returns the (widened, by each matched pattern's length) window
+// worth handing to that pattern's regexp for verification. Patterns in
+// idx.Short have no seed and so always get the whole sequence as their
+// one candidate window.
+func (idx *SeedIndex) candidateWindows(seq []byte) map[int][][2]int {
+	windows := make(map[int][][2]int)
+
+	if idx.K > 0 && len(seq) >= idx.K {
+		for i := 0; i+idx.K <= len(seq); i++ {
+			kmer := bytes.ToUpper(seq[i : i+idx.K])
+			ids, ok := idx.Seeds[string(kmer)]
+			if !ok {
+				continue
+			}
+			for _, id := range ids {
+				patLen := idx.Patterns[id].Length
+
+				start := i - patLen
+				if start < 0 {
+					start = 0
+				}
+				end := i + idx.K + patLen
+				if end > len(seq) {
+					end = len(seq)
+				}
+
+				windows[id] = append(windows[id], [2]int{start, end})
+			}
+		}
+	}
+
+	for _, id := range idx.Short {
+		if len(seq) > 0 {
+			windows[id] = append(windows[id], [2]int{0, len(seq)})
+		}
+	}
+
+	return windows
+}
+
+// compileRegexps recompiles every pattern's stored regexp source, in
+// pattern-ID order, ready for seed-hit verification.
+func (idx *SeedIndex) compileRegexps() ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, len(idx.Patterns))
+	for i, p := range idx.Patterns {
+		re, err := regexp.Compile(string(p.Regexp))
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %v", p.Name, err)
+		}
+		res[i] = re
+	}
+	return res, nil
+}
+
+// Save writes idx to file as [magic][gob-encoded version][gob-encoded
+// SeedIndex].
+func (idx *SeedIndex) Save(file string) error {
+	fh, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	w := bufio.NewWriter(fh)
+	if _, err := w.WriteString(seedIndexMagic); err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(w).Encode(seedIndexVersion); err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(w).Encode(idx); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// LoadSeedIndex reads a SeedIndex previously written by Save.
+func LoadSeedIndex(file string) (*SeedIndex, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	r := bufio.NewReader(fh)
+
+	magic := make([]byte, len(seedIndexMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != seedIndexMagic {
+		return nil, fmt.Errorf("%s: not a seqkit seed index file (bad magic bytes)", file)
+	}
+
+	var version uint32
+	if err := gob.NewDecoder(r).Decode(&version); err != nil {
+		return nil, err
+	}
+	if version != seedIndexVersion {
+		return nil, fmt.Errorf("%s: unsupported seed index version %d (this seqkit supports %d)", file, version, seedIndexVersion)
+	}
+
+	idx := &SeedIndex{}
+	if err := gob.NewDecoder(r).Decode(idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// buildSeedIndexFromPatternFile reads motifs from a FASTA pattern file,
+// compiling the same regexp each motif would get in `seqkit locate`, and
+// returns the resulting SeedIndex.
+func buildSeedIndexFromPatternFile(patternFile string, k int, degenerate, ignoreCase bool) (*SeedIndex, error) {
+	records, err := fasta.GetSeqsMap(patternFile, nil, 1000, runtime.NumCPU(), "")
+	if err != nil {
+		return nil, err
+	}
+
+	idx := NewSeedIndex(k)
+	for name, record := range records {
+		pat := record.Seq.Seq
+
+		var s string
+		if degenerate {
+			s = record.Seq.Degenerate2Regexp()
+		} else {
+			s = string(pat)
+		}
+		if ignoreCase {
+			s = "(?i)" + s
+		}
+		if _, err := regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("pattern %q: %v", name, err)
+		}
+
+		idx.Add(name, pat, s)
+	}
+
+	return idx, nil
+}
+
+// seedIndexScanStrand verifies every seed hit in strandSeq (the record's
+// sequence for strand==1, or its reverse complement for strand==-1) and
+// returns one LocationInfo per pattern that matched, with coordinates
+// translated back into the original (forward-strand) frame. rcLen is the
+// length of strandSeq when strand==-1, used for that translation.
+func seedIndexScanStrand(record *fasta.FastaRecord, idx *SeedIndex, regexps []*regexp.Regexp, strandSeq []byte, strand int, rcLen int) []LocationInfo {
+	windows := idx.candidateWindows(strandSeq)
+
+	var locations []LocationInfo
+	for id, wins := range windows {
+		re := regexps[id]
+
+		seen := make(map[[2]int]bool)
+		var locs [][]int
+		for _, w := range wins {
+			for _, m := range re.FindAllSubmatchIndex(strandSeq[w[0]:w[1]], -1) {
+				start, end := w[0]+m[0], w[0]+m[1]
+				if strand == -1 {
+					start, end = rcLen-end, rcLen-start
+				}
+
+				key := [2]int{start, end}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				locs = append(locs, []int{start, end})
+			}
+		}
+
+		if len(locs) > 0 {
+			locations = append(locations, LocationInfo{record, idx.Patterns[id].Name, strand, locs})
+		}
+	}
+	return locations
+}
+
+// scanSeedIndexRecord is the --index counterpart of scanACRecord: it
+// verifies seed hits on both strands (unless onlyPositiveStrand) and
+// returns the resulting LocationInfo entries.
+func scanSeedIndexRecord(record *fasta.FastaRecord, idx *SeedIndex, regexps []*regexp.Regexp, onlyPositiveStrand bool) []LocationInfo {
+	locations := seedIndexScanStrand(record, idx, regexps, record.Seq.Seq, 1, 0)
+
+	if onlyPositiveStrand {
+		return locations
+	}
+
+	seqRP := record.Seq.RevCom()
+	locations = append(locations, seedIndexScanStrand(record, idx, regexps, seqRP.Seq, -1, len(seqRP.Seq))...)
+
+	return locations
+}
@@ -0,0 +1,84 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// locateIndexCmd represents the parent `locate-index` command.
+var locateIndexCmd = &cobra.Command{
+	Use:   "locate-index",
+	Short: "build a persistent motif index for `seqkit locate --index`",
+	Long: `build a persistent motif index for seqkit locate --index
+
+A seed index precomputes a k-mer prefilter over a fixed motif set, so
+repeated "seqkit locate" runs against many FASTA files only have to run
+full regexp verification where a k-mer seed actually matched.
+`,
+}
+
+// locateIndexBuildCmd represents "locate-index build".
+var locateIndexBuildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "build a motif seed index",
+	Long: `build a motif seed index
+
+Example:
+
+    seqkit locate-index build --pattern-file motifs.fa -k 8 -o motifs.idx
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		patternFile := getFlagString(cmd, "pattern-file")
+		k := getFlagInt(cmd, "kmer-len")
+		degenerate := getFlagBool(cmd, "degenerate")
+		ignoreCase := getFlagBool(cmd, "ignore-case")
+		outFile := getFlagString(cmd, "out-file")
+
+		if patternFile == "" {
+			checkError(fmt.Errorf("flag --pattern-file needed"))
+		}
+		if k <= 0 {
+			checkError(fmt.Errorf("value of flag -k should be greater than 0"))
+		}
+		if outFile == "" {
+			checkError(fmt.Errorf("flag --out-file/-o needed"))
+		}
+
+		idx, err := buildSeedIndexFromPatternFile(patternFile, k, degenerate, ignoreCase)
+		checkError(err)
+
+		checkError(idx.Save(outFile))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(locateIndexCmd)
+	locateIndexCmd.AddCommand(locateIndexBuildCmd)
+
+	locateIndexBuildCmd.Flags().StringP("pattern-file", "f", "", "pattern/motif file (FASTA format)")
+	locateIndexBuildCmd.Flags().IntP("kmer-len", "k", 8, "seed k-mer length")
+	locateIndexBuildCmd.Flags().BoolP("degenerate", "d", false, "pattern/motif contains degenerate base")
+	locateIndexBuildCmd.Flags().BoolP("ignore-case", "i", false, "ignore case")
+	locateIndexBuildCmd.Flags().StringP("out-file", "o", "", "index output file")
+}
@@ -0,0 +1,264 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brentp/xopen"
+)
+
+// maskRegion is a half-open, 0-based [start, end) interval on one seqID.
+type maskRegion struct {
+	start, end int
+}
+
+// maskRegionsBySeq holds the regions parsed from --mask-regions, nil when
+// the flag isn't set.
+var maskRegionsBySeq map[string][]maskRegion
+
+// maskRegionsInvert mirrors --invert: when true, hits that do NOT overlap
+// any mask region are the ones dropped instead of kept.
+var maskRegionsInvert bool
+
+// mergeHits mirrors --merge.
+var mergeHits bool
+
+// nonOverlappingHits mirrors --non-overlapping.
+var nonOverlappingHits bool
+
+// loadMaskRegions parses a BED or GFF3 file (format detected from its
+// extension) into a map of seqID -> sorted regions.
+func loadMaskRegions(file string) (map[string][]maskRegion, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	// xopen.Ropen already transparently decompresses a .gz suffix, so strip
+	// it before inspecting the extension that actually names the format.
+	name := file
+	if ext := filepath.Ext(name); strings.EqualFold(ext, ".gz") {
+		name = strings.TrimSuffix(name, ext)
+	}
+	isGFF3 := strings.HasPrefix(strings.ToLower(filepath.Ext(name)), ".gff")
+
+	regions := make(map[string][]maskRegion)
+	var dataLines int
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dataLines++
+		fields := strings.Split(line, "\t")
+
+		var seqID string
+		var start, end int
+		if isGFF3 {
+			if len(fields) < 5 {
+				continue
+			}
+			s, err := strconv.Atoi(fields[3])
+			if err != nil {
+				continue
+			}
+			e, err := strconv.Atoi(fields[4])
+			if err != nil {
+				continue
+			}
+			seqID, start, end = fields[0], s-1, e // GFF3 is 1-based, inclusive
+		} else {
+			if len(fields) < 3 {
+				continue
+			}
+			s, err := strconv.Atoi(fields[1])
+			if err != nil {
+				continue
+			}
+			e, err := strconv.Atoi(fields[2])
+			if err != nil {
+				continue
+			}
+			seqID, start, end = fields[0], s, e // BED is already 0-based, half-open
+		}
+
+		regions[seqID] = append(regions[seqID], maskRegion{start, end})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if dataLines > 0 && len(regions) == 0 {
+		format := "BED"
+		if isGFF3 {
+			format = "GFF3"
+		}
+		return nil, fmt.Errorf("--mask-regions file %q: read %d data line(s) but parsed 0 regions as %s, wrong format detected?", file, dataLines, format)
+	}
+
+	for seqID := range regions {
+		sort.Slice(regions[seqID], func(i, j int) bool {
+			return regions[seqID][i].start < regions[seqID][j].start
+		})
+	}
+
+	return regions, nil
+}
+
+// overlapsMask reports whether [start, end) overlaps any region recorded
+// for seqID in maskRegionsBySeq.
+func overlapsMask(seqID string, start, end int) bool {
+	for _, r := range maskRegionsBySeq[seqID] {
+		if start < r.end && r.start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByMask drops (or, with maskRegionsInvert, keeps) hits overlapping
+// maskRegionsBySeq[seqID].
+func filterByMask(seqID string, locs [][]int) [][]int {
+	if maskRegionsBySeq == nil {
+		return locs
+	}
+
+	var kept [][]int
+	for _, loc := range locs {
+		if overlapsMask(seqID, loc[0], loc[1]) == maskRegionsInvert {
+			kept = append(kept, loc)
+		}
+	}
+	return kept
+}
+
+// mergeLocations collapses overlapping or adjacent intervals into
+// [start, end, hitCount] intervals reporting the union range and the
+// number of hits it absorbed.
+func mergeLocations(locs [][]int) [][]int {
+	if len(locs) == 0 {
+		return locs
+	}
+
+	sorted := append([][]int(nil), locs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+
+	var merged [][]int
+	start, end, count := sorted[0][0], sorted[0][1], 1
+	for _, loc := range sorted[1:] {
+		if loc[0] <= end { // overlapping or adjacent
+			if loc[1] > end {
+				end = loc[1]
+			}
+			count++
+			continue
+		}
+		merged = append(merged, []int{start, end, count})
+		start, end, count = loc[0], loc[1], 1
+	}
+	merged = append(merged, []int{start, end, count})
+
+	return merged
+}
+
+// postProcessLocations applies --mask-regions and --merge (in that order)
+// to one (seqID, pattern, strand) bucket of hits, exactly as buffered by
+// the receiver goroutine, so the streaming output order is unaffected.
+// --non-overlapping is handled separately, by
+// selectNonOverlappingAcrossPatterns, because unlike --merge it's scoped
+// to every pattern sharing a seqID/strand, not just one.
+func postProcessLocations(seqID string, locs [][]int) [][]int {
+	locs = filterByMask(seqID, locs)
+
+	if mergeHits {
+		locs = mergeLocations(locs)
+	}
+
+	return locs
+}
+
+// locTag associates one post-merge hit with the bucket (index into a
+// LocationChunk's Data) it came from, so selectNonOverlappingAcrossPatterns
+// can pool hits from several patterns and still report which bucket each
+// survivor belongs to.
+type locTag struct {
+	owner int
+	idx   int
+	loc   []int
+}
+
+// selectNonOverlappingAcrossPatterns applies --non-overlapping across
+// every bucket in infos/locs that shares a (seqID, strand) pair. Unlike
+// --merge, which the request scopes to "same pattern", --non-overlapping
+// is documented as greedily selecting a maximal non-overlapping hit set per
+// seqID/strand, so two different motifs that overlap each other must
+// still only let one survive.
+func selectNonOverlappingAcrossPatterns(infos []LocationInfo, locs [][][]int) [][][]int {
+	type bucketKey struct {
+		seqID  string
+		strand int
+	}
+
+	buckets := make(map[bucketKey][]locTag)
+	for owner, info := range infos {
+		key := bucketKey{info.Record.ID, info.Strand}
+		for idx, loc := range locs[owner] {
+			buckets[key] = append(buckets[key], locTag{owner, idx, loc})
+		}
+	}
+
+	kept := make(map[[2]int]bool)
+	for _, items := range buckets {
+		sorted := append([]locTag(nil), items...)
+		sort.Slice(sorted, func(i, j int) bool {
+			if sorted[i].loc[0] != sorted[j].loc[0] {
+				return sorted[i].loc[0] < sorted[j].loc[0]
+			}
+			return sorted[i].loc[1] < sorted[j].loc[1]
+		})
+
+		lastEnd := -1
+		for _, it := range sorted {
+			if it.loc[0] >= lastEnd {
+				kept[[2]int{it.owner, it.idx}] = true
+				lastEnd = it.loc[1]
+			}
+		}
+	}
+
+	result := make([][][]int, len(locs))
+	for owner := range locs {
+		for idx, loc := range locs[owner] {
+			if kept[[2]int{owner, idx}] {
+				result[owner] = append(result[owner], loc)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/shenwei356/bio/seqio/fasta"
+)
+
+func TestMergeLocationsNestedIntervals(t *testing.T) {
+	// [20,30) is entirely inside [10,50); the union is just the outer one.
+	got := mergeLocations([][]int{{10, 50}, {20, 30}})
+	want := [][]int{{10, 50, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeLocations nested = %v, want %v", got, want)
+	}
+}
+
+func TestMergeLocationsAdjacent(t *testing.T) {
+	// adjacent (end == next start) intervals merge into one...
+	got := mergeLocations([][]int{{0, 10}, {10, 20}})
+	want := [][]int{{0, 20, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeLocations adjacent = %v, want %v", got, want)
+	}
+
+	// ...but a true gap does not.
+	got = mergeLocations([][]int{{0, 10}, {11, 20}})
+	want = [][]int{{0, 10, 1}, {11, 20, 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeLocations gap = %v, want %v", got, want)
+	}
+}
+
+func TestMergeLocationsStrandAware(t *testing.T) {
+	// --merge is scoped to one (seqID, pattern, strand) bucket: hits at
+	// the same coordinates on opposite strands are two separate buckets
+	// and must be merged independently, never against each other.
+	fwd := mergeLocations([][]int{{10, 20}, {15, 25}})
+	rev := mergeLocations([][]int{{10, 20}, {15, 25}})
+
+	want := [][]int{{10, 25, 2}}
+	if !reflect.DeepEqual(fwd, want) {
+		t.Errorf("mergeLocations forward bucket = %v, want %v", fwd, want)
+	}
+	if !reflect.DeepEqual(rev, want) {
+		t.Errorf("mergeLocations reverse bucket = %v, want %v", rev, want)
+	}
+}
+
+func TestSelectNonOverlappingAcrossPatternsNestedIntervals(t *testing.T) {
+	// two different patterns hitting the same seqID/strand: the nested
+	// hit from motifB starts before motifA's outer hit ends, so it must
+	// be dropped even though it's a different pattern's bucket.
+	chr1 := &fasta.FastaRecord{ID: "chr1"}
+	infos := []LocationInfo{
+		{Record: chr1, PatternName: "motifA", Strand: 1},
+		{Record: chr1, PatternName: "motifB", Strand: 1},
+	}
+	locs := [][][]int{
+		{{0, 100}},
+		{{10, 20}},
+	}
+
+	got := selectNonOverlappingAcrossPatterns(infos, locs)
+	want := [][][]int{
+		{{0, 100}},
+		nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("selectNonOverlappingAcrossPatterns nested = %v, want %v", got, want)
+	}
+}
+
+func TestSelectNonOverlappingAcrossPatternsAdjacent(t *testing.T) {
+	// adjacent (end == next start) hits from two different patterns don't
+	// overlap, so both survive.
+	chr1 := &fasta.FastaRecord{ID: "chr1"}
+	infos := []LocationInfo{
+		{Record: chr1, PatternName: "motifA", Strand: 1},
+		{Record: chr1, PatternName: "motifB", Strand: 1},
+	}
+	locs := [][][]int{
+		{{0, 10}},
+		{{10, 20}},
+	}
+
+	got := selectNonOverlappingAcrossPatterns(infos, locs)
+	want := [][][]int{
+		{{0, 10}},
+		{{10, 20}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("selectNonOverlappingAcrossPatterns adjacent = %v, want %v", got, want)
+	}
+}
+
+func TestSelectNonOverlappingAcrossPatternsStrandAware(t *testing.T) {
+	// --non-overlapping is scoped per (seqID, strand): two patterns that
+	// overlap in coordinates but hit opposite strands are different
+	// buckets and must not suppress each other.
+	chr1 := &fasta.FastaRecord{ID: "chr1"}
+	infos := []LocationInfo{
+		{Record: chr1, PatternName: "motifA", Strand: 1},
+		{Record: chr1, PatternName: "motifB", Strand: -1},
+	}
+	locs := [][][]int{
+		{{0, 20}},
+		{{10, 30}},
+	}
+
+	got := selectNonOverlappingAcrossPatterns(infos, locs)
+	want := [][][]int{
+		{{0, 20}},
+		{{10, 30}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("selectNonOverlappingAcrossPatterns strand-aware = %v, want %v", got, want)
+	}
+}
+
+func TestFilterByMask(t *testing.T) {
+	old := maskRegionsBySeq
+	oldInvert := maskRegionsInvert
+	defer func() {
+		maskRegionsBySeq = old
+		maskRegionsInvert = oldInvert
+	}()
+
+	maskRegionsBySeq = map[string][]maskRegion{
+		"chr1": {{10, 20}},
+	}
+
+	maskRegionsInvert = false
+	got := filterByMask("chr1", [][]int{{0, 5}, {15, 25}})
+	want := [][]int{{0, 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filterByMask = %v, want %v", got, want)
+	}
+
+	maskRegionsInvert = true
+	got = filterByMask("chr1", [][]int{{0, 5}, {15, 25}})
+	want = [][]int{{15, 25}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filterByMask invert = %v, want %v", got, want)
+	}
+}
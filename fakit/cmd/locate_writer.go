@@ -0,0 +1,64 @@
+// Copyright © 2016 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/brentp/xopen"
+)
+
+// locationWriter writes the hits found by `seqkit locate` to outfh in a
+// particular output format. Each supported --out-format value has its own
+// implementation in a dedicated locate_format_*.go file.
+type locationWriter interface {
+	// WriteHeader writes any header line(s) required by the format. It is
+	// called once per output file, before any hits are written.
+	WriteHeader(outfh *xopen.Writer) error
+
+	// WriteHit writes a single pattern hit. matched is the matched
+	// sequence, already reverse-complemented for negative-strand hits.
+	WriteHit(outfh *xopen.Writer, patterns map[string][]byte, locationInfo LocationInfo, loc []int, matched []byte) error
+}
+
+// newLocationWriter returns the locationWriter for the given --out-format
+// value, defaulting to the original TSV format when format is empty.
+func newLocationWriter(format string) (locationWriter, error) {
+	switch format {
+	case "", "tsv":
+		return tsvLocationWriter{}, nil
+	case "bed":
+		return bedLocationWriter{}, nil
+	case "gff3":
+		return gff3LocationWriter{}, nil
+	default:
+		return nil, fmt.Errorf("invalid value for flag --out-format: %s. available values: tsv, bed, gff3", format)
+	}
+}
+
+// strandSymbol returns "+"/"-" for the int strand representation (1/-1)
+// used throughout LocationInfo.
+func strandSymbol(strand int) string {
+	if strand == -1 {
+		return "-"
+	}
+	return "+"
+}